@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// NoExpiration and DisabledBucket are the two special BucketConfig.MaxAge
+// sentinel values. Any other non-negative duration is treated literally.
+const (
+	NoExpiration   time.Duration = -1
+	DisabledBucket time.Duration = 0
+)
+
+// BucketConfig describes a named cache bucket: where it lives remotely, which
+// local mount paths restore into it, and how long entries restored into it
+// are considered fresh.
+type BucketConfig struct {
+	Dir       string
+	Namespace string
+	MaxAge    time.Duration
+	Mounts    []string
+}
+
+// Buckets maps a bucket name (e.g. "deps", "build", "assets") to its config.
+type Buckets map[string]BucketConfig
+
+// Resolve returns the bucket whose Mounts best match dst, the longest
+// matching mount winning ties. ok is false when no bucket claims dst, in
+// which case callers should fall back to the restorer's default namespace
+// and no expiration.
+func (b Buckets) Resolve(dst string) (name string, cfg BucketConfig, ok bool) {
+	var bestLen int
+
+	for n, c := range b {
+		for _, mount := range c.Mounts {
+			if !mountMatches(dst, mount) {
+				continue
+			}
+
+			if len(mount) > bestLen {
+				name, cfg, ok = n, c, true
+				bestLen = len(mount)
+			}
+		}
+	}
+
+	return name, cfg, ok
+}
+
+// mountMatches reports whether dst is mount itself or a path under it,
+// rather than merely sharing a string prefix with it — e.g. mount "build"
+// must not match dst "builder-output/x".
+func mountMatches(dst, mount string) bool {
+	dst, mount = filepath.ToSlash(filepath.Clean(dst)), filepath.ToSlash(filepath.Clean(mount))
+
+	return dst == mount || strings.HasPrefix(dst, mount+"/")
+}
+
+// expired reports whether an entry last modified at modTime has aged past
+// the bucket's MaxAge. A bucket with NoExpiration never expires.
+func (c BucketConfig) expired(modTime time.Time) bool {
+	if c.MaxAge == NoExpiration {
+		return false
+	}
+
+	return time.Since(modTime) > c.MaxAge
+}
@@ -0,0 +1,42 @@
+package cache
+
+import "testing"
+
+func TestBucketsResolveRespectsPathBoundary(t *testing.T) {
+	buckets := Buckets{
+		"build": BucketConfig{MaxAge: NoExpiration, Mounts: []string{"build"}},
+	}
+
+	t.Run("exact mount matches", func(t *testing.T) {
+		name, _, ok := buckets.Resolve("build")
+		if !ok || name != "build" {
+			t.Fatalf("expected dst \"build\" to resolve to bucket \"build\", got name=%q ok=%v", name, ok)
+		}
+	})
+
+	t.Run("nested path under mount matches", func(t *testing.T) {
+		name, _, ok := buckets.Resolve("build/output")
+		if !ok || name != "build" {
+			t.Fatalf("expected dst \"build/output\" to resolve to bucket \"build\", got name=%q ok=%v", name, ok)
+		}
+	})
+
+	t.Run("sibling directory sharing a string prefix does not match", func(t *testing.T) {
+		_, _, ok := buckets.Resolve("builder-output/x")
+		if ok {
+			t.Fatal("expected dst \"builder-output/x\" not to match mount \"build\"")
+		}
+	})
+}
+
+func TestBucketsResolveLongestMountWins(t *testing.T) {
+	buckets := Buckets{
+		"deps":        BucketConfig{Mounts: []string{"deps"}},
+		"deps-nested": BucketConfig{Mounts: []string{"deps/nested"}},
+	}
+
+	name, _, ok := buckets.Resolve("deps/nested/file")
+	if !ok || name != "deps-nested" {
+		t.Fatalf("expected the longer, more specific mount to win, got name=%q ok=%v", name, ok)
+	}
+}
@@ -0,0 +1,337 @@
+// Package diskcache implements a local, on-disk caching layer that can wrap
+// any storage.Storage backend. It lets repeated restores on the same host
+// (self-hosted runners, warm build agents) be served from local disk instead
+// of re-downloading identical archives from the remote backend every time.
+package diskcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+
+	"github.com/meltwater/drone-cache/internal"
+	"github.com/meltwater/drone-cache/storage"
+	"github.com/meltwater/drone-cache/storage/common"
+)
+
+// Config configures the on-disk cache layer.
+type Config struct {
+	// Dir is the local directory entries are cached under.
+	Dir string
+	// MaxSizeBytes is the total size, in bytes, the cache is allowed to grow
+	// to before the eviction loop reclaims space. Zero means unbounded.
+	MaxSizeBytes int64
+	// MaxEntries caps the number of cached entries. Zero means unbounded.
+	MaxEntries int
+	// MaxAge is how long an entry is considered fresh. Zero means entries
+	// never expire on their own (they are still subject to size eviction).
+	MaxAge time.Duration
+}
+
+// entryMeta is the sidecar JSON persisted next to every cached file.
+type entryMeta struct {
+	UpstreamPath string    `json:"upstream_path"`
+	Size         int64     `json:"size"`
+	ModTime      time.Time `json:"mod_time"`
+	SHA256       string    `json:"sha256"`
+	LastAccess   time.Time `json:"last_access"`
+}
+
+// stats holds the running hit/miss/bytes counters for a Cache.
+type stats struct {
+	mu     sync.Mutex
+	hits   int
+	misses int
+	bytes  int64
+}
+
+// Cache wraps a storage.Storage backend with a local on-disk cache. It
+// implements storage.Storage itself so it can be used as a drop-in
+// replacement wherever the remote backend was used directly.
+type Cache struct {
+	logger   log.Logger
+	upstream storage.Storage
+	cfg      Config
+	stats    stats
+}
+
+// New creates a Cache wrapping upstream. The cache directory is created if it
+// does not already exist.
+func New(logger log.Logger, upstream storage.Storage, cfg Config) (*Cache, error) {
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("create local cache dir <%s>, %w", cfg.Dir, err)
+	}
+
+	return &Cache{logger: logger, upstream: upstream, cfg: cfg}, nil
+}
+
+// Get writes the contents addressed by p to w, serving from the local cache
+// when a fresh copy is present and falling back to upstream on miss.
+func (c *Cache) Get(p string, w io.Writer) (err error) {
+	entryPath, metaPath := c.paths(p)
+
+	if meta, ok := c.readMeta(metaPath); ok && c.isFresh(meta) {
+		f, openErr := os.Open(entryPath)
+		if openErr == nil {
+			defer internal.CloseWithErrLogf(c.logger, f, "diskcache, cache entry close <%s>", entryPath)
+
+			if _, copyErr := io.Copy(w, f); copyErr == nil {
+				c.recordHit(meta.Size)
+				c.touch(metaPath, meta)
+
+				level.Debug(c.logger).Log("msg", "local cache hit", "path", p)
+
+				return nil
+			}
+		}
+	}
+
+	c.recordMiss()
+
+	level.Debug(c.logger).Log("msg", "local cache miss", "path", p)
+
+	return c.populate(p, w, entryPath, metaPath)
+}
+
+// populate streams p from upstream into w while simultaneously writing a
+// temp file that is atomically renamed into the cache on success.
+func (c *Cache) populate(p string, w io.Writer, entryPath, metaPath string) (err error) {
+	if err := os.MkdirAll(filepath.Dir(entryPath), 0755); err != nil {
+		return fmt.Errorf("create cache entry dir, %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(entryPath), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create temp cache file, %w", err)
+	}
+
+	tmpClosed := false
+	defer func() {
+		if !tmpClosed {
+			internal.CloseWithErrCapturef(&err, tmp, "diskcache, temp file close <%s>", tmp.Name())
+		}
+		os.Remove(tmp.Name()) // nolint:errcheck // best-effort cleanup, rename below moves it away on success
+	}()
+
+	h := sha256.New()
+	pr, pw := io.Pipe()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		defer internal.CloseWithErrLogf(c.logger, pw, "diskcache, pipe writer close")
+
+		if err := c.upstream.Get(p, pw); err != nil {
+			pw.CloseWithError(fmt.Errorf("get from upstream, %w", err)) // nolint:errcheck
+		}
+	}()
+
+	// Closing pr before waiting unblocks the goroutine above if it's still
+	// writing to pw when io.Copy below fails, so a cancelled/failed restore
+	// can't leak it holding the upstream connection open forever.
+	defer wg.Wait()
+	defer internal.CloseWithErrCapturef(&err, pr, "diskcache, pr close <%s>", p)
+
+	written, err := io.Copy(io.MultiWriter(w, tmp, h), pr)
+	if err != nil {
+		return fmt.Errorf("stream upstream entry to local cache, %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close temp cache file, %w", err)
+	}
+	tmpClosed = true
+
+	if err := os.Rename(tmp.Name(), entryPath); err != nil {
+		return fmt.Errorf("rename temp cache file into place, %w", err)
+	}
+
+	meta := entryMeta{
+		UpstreamPath: p,
+		Size:         written,
+		ModTime:      time.Now(),
+		SHA256:       hex.EncodeToString(h.Sum(nil)),
+		LastAccess:   time.Now(),
+	}
+	if err := c.writeMeta(metaPath, meta); err != nil {
+		level.Error(c.logger).Log("msg", "write cache sidecar metadata", "err", err)
+	}
+
+	c.recordBytes(written)
+
+	go func() {
+		if err := c.evict(); err != nil {
+			level.Error(c.logger).Log("msg", "evict local cache entries", "err", err)
+		}
+	}()
+
+	return nil
+}
+
+// Put, Exists, Delete and List are passed straight through to upstream; the
+// local cache only interposes on reads.
+func (c *Cache) Put(p string, r io.Reader) error            { return c.upstream.Put(p, r) }
+func (c *Cache) Exists(p string) (bool, error)              { return c.upstream.Exists(p) }
+func (c *Cache) Delete(p string) error                      { return c.upstream.Delete(p) }
+func (c *Cache) List(p string) ([]storage.FileEntry, error) { return c.upstream.List(p) }
+
+// Presign forwards to the upstream backend's Presign method when it has
+// one, so wrapping a presign-capable backend in a local disk cache doesn't
+// silently break presigned restores. Backends that don't support presigning
+// return common.ErrNotImplemented, same as calling them directly would.
+func (c *Cache) Presign(p string, ttl time.Duration) (string, error) {
+	presigner, ok := c.upstream.(interface {
+		Presign(string, time.Duration) (string, error)
+	})
+	if !ok {
+		return "", common.ErrNotImplemented
+	}
+
+	return presigner.Presign(p, ttl)
+}
+
+// Stats returns a point-in-time snapshot of the cache's hit/miss/bytes
+// counters.
+func (c *Cache) Stats() (hits, misses int, bytes int64) {
+	c.stats.mu.Lock()
+	defer c.stats.mu.Unlock()
+
+	return c.stats.hits, c.stats.misses, c.stats.bytes
+}
+
+// Helpers
+
+func (c *Cache) paths(p string) (entryPath, metaPath string) {
+	sum := sha256.Sum256([]byte(p))
+	key := hex.EncodeToString(sum[:])
+	entryPath = filepath.Join(c.cfg.Dir, key)
+
+	return entryPath, entryPath + ".meta.json"
+}
+
+func (c *Cache) isFresh(meta entryMeta) bool {
+	if c.cfg.MaxAge <= 0 {
+		return true
+	}
+
+	return time.Since(meta.ModTime) < c.cfg.MaxAge
+}
+
+func (c *Cache) readMeta(metaPath string) (entryMeta, bool) {
+	b, err := os.ReadFile(metaPath)
+	if err != nil {
+		return entryMeta{}, false
+	}
+
+	var meta entryMeta
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return entryMeta{}, false
+	}
+
+	return meta, true
+}
+
+func (c *Cache) writeMeta(metaPath string, meta entryMeta) error {
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(metaPath, b, 0644)
+}
+
+func (c *Cache) touch(metaPath string, meta entryMeta) {
+	meta.LastAccess = time.Now()
+	if err := c.writeMeta(metaPath, meta); err != nil {
+		level.Error(c.logger).Log("msg", "touch cache sidecar metadata", "err", err)
+	}
+}
+
+func (c *Cache) recordHit(bytes int64) {
+	c.stats.mu.Lock()
+	defer c.stats.mu.Unlock()
+	c.stats.hits++
+	c.stats.bytes += bytes
+}
+
+func (c *Cache) recordMiss() {
+	c.stats.mu.Lock()
+	defer c.stats.mu.Unlock()
+	c.stats.misses++
+}
+
+func (c *Cache) recordBytes(n int64) {
+	c.stats.mu.Lock()
+	defer c.stats.mu.Unlock()
+	c.stats.bytes += n
+}
+
+// evict enforces the configured size/entry caps by removing the
+// least-recently-accessed entries until the cache is back under budget.
+func (c *Cache) evict() error {
+	if c.cfg.MaxSizeBytes <= 0 && c.cfg.MaxEntries <= 0 {
+		return nil
+	}
+
+	type candidate struct {
+		entryPath string
+		metaPath  string
+		meta      entryMeta
+	}
+
+	var (
+		candidates []candidate
+		total      int64
+	)
+
+	err := filepath.Walk(c.cfg.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Ext(path) != ".json" {
+			return nil // nolint:nilerr // best-effort walk, skip unreadable entries
+		}
+
+		entryPath := path[:len(path)-len(".meta.json")]
+		meta, ok := c.readMeta(path)
+		if !ok {
+			return nil
+		}
+
+		candidates = append(candidates, candidate{entryPath, path, meta})
+		total += meta.Size
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("walk local cache dir, %w", err)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].meta.LastAccess.Before(candidates[j].meta.LastAccess)
+	})
+
+	for _, cand := range candidates {
+		overSize := c.cfg.MaxSizeBytes > 0 && total > c.cfg.MaxSizeBytes
+		overCount := c.cfg.MaxEntries > 0 && len(candidates) > c.cfg.MaxEntries
+		if !overSize && !overCount {
+			break
+		}
+
+		os.Remove(cand.entryPath) // nolint:errcheck // best-effort eviction
+		os.Remove(cand.metaPath)  // nolint:errcheck // best-effort eviction
+		total -= cand.meta.Size
+		candidates = candidates[1:]
+	}
+
+	return nil
+}
@@ -0,0 +1,190 @@
+package diskcache
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/meltwater/drone-cache/storage"
+	"github.com/meltwater/drone-cache/storage/common"
+)
+
+// fakeStorage is a minimal storage.Storage for tests that don't need a real
+// backend.
+type fakeStorage struct{}
+
+func (fakeStorage) Get(string, io.Writer) error              { return nil }
+func (fakeStorage) Put(string, io.Reader) error              { return nil }
+func (fakeStorage) Exists(string) (bool, error)              { return false, nil }
+func (fakeStorage) Delete(string) error                      { return nil }
+func (fakeStorage) List(string) ([]storage.FileEntry, error) { return nil, nil }
+
+// fakePresignStorage additionally implements Presign, like a real S3/GCS/Azure backend would.
+type fakePresignStorage struct {
+	fakeStorage
+	url string
+}
+
+func (f fakePresignStorage) Presign(string, time.Duration) (string, error) { return f.url, nil }
+
+// recordingStorage serves fixed content and counts how many times Get is
+// called, so tests can assert a cache hit never reaches upstream.
+type recordingStorage struct {
+	fakeStorage
+	mu      sync.Mutex
+	calls   int
+	content []byte
+}
+
+func (s *recordingStorage) Get(_ string, w io.Writer) error {
+	s.mu.Lock()
+	s.calls++
+	s.mu.Unlock()
+
+	_, err := w.Write(s.content)
+
+	return err
+}
+
+func (s *recordingStorage) getCalls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.calls
+}
+
+func TestCacheGetPopulatesOnMissAndServesFromDiskOnHit(t *testing.T) {
+	upstream := &recordingStorage{content: []byte("hello cache")}
+	c := &Cache{logger: log.NewNopLogger(), upstream: upstream, cfg: Config{Dir: t.TempDir()}}
+
+	var first bytes.Buffer
+	if err := c.Get("namespace/key/deps", &first); err != nil {
+		t.Fatalf("unexpected error on miss: %v", err)
+	}
+
+	if first.String() != "hello cache" {
+		t.Fatalf("got %q on miss, want %q", first.String(), "hello cache")
+	}
+
+	if hits, misses, _ := c.Stats(); hits != 0 || misses != 1 {
+		t.Fatalf("after miss, stats = hits=%d misses=%d, want hits=0 misses=1", hits, misses)
+	}
+
+	_, metaPath := c.paths("namespace/key/deps")
+	meta, ok := c.readMeta(metaPath)
+	if !ok {
+		t.Fatal("expected sidecar metadata to be written after populate")
+	}
+
+	if meta.UpstreamPath != "namespace/key/deps" || meta.Size != int64(len("hello cache")) {
+		t.Fatalf("sidecar metadata = %+v, want upstream path %q and size %d", meta, "namespace/key/deps", len("hello cache"))
+	}
+
+	var second bytes.Buffer
+	if err := c.Get("namespace/key/deps", &second); err != nil {
+		t.Fatalf("unexpected error on hit: %v", err)
+	}
+
+	if second.String() != "hello cache" {
+		t.Fatalf("got %q on hit, want %q", second.String(), "hello cache")
+	}
+
+	if calls := upstream.getCalls(); calls != 1 {
+		t.Fatalf("upstream.Get called %d times, want 1 (second Get should be served from disk)", calls)
+	}
+
+	if hits, misses, _ := c.Stats(); hits != 1 || misses != 1 {
+		t.Fatalf("after hit, stats = hits=%d misses=%d, want hits=1 misses=1", hits, misses)
+	}
+}
+
+func TestCachePresignForwardsToUpstreamWhenSupported(t *testing.T) {
+	c := &Cache{logger: log.NewNopLogger(), upstream: fakePresignStorage{url: "https://example.com/signed"}}
+
+	url, err := c.Presign("namespace/key/deps", time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if url != "https://example.com/signed" {
+		t.Fatalf("got url %q, want forwarded upstream url", url)
+	}
+}
+
+func TestCachePresignNotImplementedWhenUpstreamLacksIt(t *testing.T) {
+	c := &Cache{logger: log.NewNopLogger(), upstream: fakeStorage{}}
+
+	if _, err := c.Presign("namespace/key/deps", time.Minute); err != common.ErrNotImplemented {
+		t.Fatalf("got err %v, want common.ErrNotImplemented", err)
+	}
+}
+
+func TestCachePathsAreFixedLength(t *testing.T) {
+	c := &Cache{logger: log.NewNopLogger(), cfg: Config{Dir: t.TempDir()}}
+
+	short := "short/path"
+	long := filepath.Join("namespace", "some-very-long-cache-key-generated-from-branch-and-commit-sha", "node_modules")
+
+	shortEntry, shortMeta := c.paths(short)
+	longEntry, longMeta := c.paths(long)
+
+	if got, want := len(filepath.Base(shortEntry)), 64; got != want {
+		t.Fatalf("short path entry key length = %d, want %d", got, want)
+	}
+
+	if got, want := len(filepath.Base(longEntry)), 64; got != want {
+		t.Fatalf("long path entry key length = %d, want %d", got, want)
+	}
+
+	if shortEntry == longEntry {
+		t.Fatal("expected different inputs to hash to different cache keys")
+	}
+
+	if shortMeta != shortEntry+".meta.json" {
+		t.Fatalf("meta path = %q, want entry path with .meta.json suffix", shortMeta)
+	}
+}
+
+func TestCacheEvictRemovesOldestFirst(t *testing.T) {
+	dir := t.TempDir()
+	c := &Cache{logger: log.NewNopLogger(), cfg: Config{Dir: dir, MaxSizeBytes: 50}}
+
+	write := func(name string, size int64, age time.Duration) {
+		entryPath := filepath.Join(dir, name)
+		if err := os.WriteFile(entryPath, make([]byte, size), 0644); err != nil {
+			t.Fatalf("write entry: %v", err)
+		}
+
+		meta := entryMeta{Size: size, LastAccess: time.Now().Add(-age)}
+		if err := c.writeMeta(entryPath+".meta.json", meta); err != nil {
+			t.Fatalf("write meta: %v", err)
+		}
+	}
+
+	write("oldest", 30, 3*time.Hour)
+	write("middle", 40, 2*time.Hour)
+	write("newest", 40, 1*time.Hour)
+
+	if err := c.evict(); err != nil {
+		t.Fatalf("evict: %v", err)
+	}
+
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, name))
+		return err == nil
+	}
+
+	if exists("oldest") {
+		t.Error("expected oldest entry to be evicted")
+	}
+
+	if !exists("newest") {
+		t.Error("expected newest entry to survive eviction")
+	}
+}
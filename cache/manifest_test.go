@@ -0,0 +1,190 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/meltwater/drone-cache/storage"
+)
+
+// memStorage is a minimal in-memory storage.Storage for tests that need
+// real Exists/Get/Put semantics over a small set of paths, rather than the
+// no-op fakes used by the helper-level tests in this package.
+type memStorage struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func newMemStorage() *memStorage {
+	return &memStorage{files: map[string][]byte{}}
+}
+
+func (m *memStorage) put(path string, data []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[path] = data
+}
+
+func (m *memStorage) Get(path string, w io.Writer) error {
+	m.mu.Lock()
+	data, ok := m.files[path]
+	m.mu.Unlock()
+
+	if !ok {
+		return os.ErrNotExist
+	}
+
+	_, err := w.Write(data)
+
+	return err
+}
+
+func (m *memStorage) Put(path string, r io.Reader) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	m.put(path, b)
+
+	return nil
+}
+
+func (m *memStorage) Exists(path string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.files[path]
+
+	return ok, nil
+}
+
+func (m *memStorage) Delete(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.files, path)
+
+	return nil
+}
+
+func (m *memStorage) List(string) ([]storage.FileEntry, error) { return nil, nil }
+
+func TestSafeJoin(t *testing.T) {
+	dst := filepath.Join("restore", "dst")
+
+	t.Run("rejects absolute paths", func(t *testing.T) {
+		if _, err := safeJoin(dst, "/etc/passwd"); err == nil {
+			t.Fatal("expected error for absolute path, got nil")
+		}
+	})
+
+	t.Run("rejects parent traversal", func(t *testing.T) {
+		if _, err := safeJoin(dst, "../../../../home/.ssh/authorized_keys"); err == nil {
+			t.Fatal("expected error for traversal path, got nil")
+		}
+	})
+
+	t.Run("rejects bare dotdot", func(t *testing.T) {
+		if _, err := safeJoin(dst, ".."); err == nil {
+			t.Fatal("expected error for '..', got nil")
+		}
+	})
+
+	t.Run("accepts a nested relative path", func(t *testing.T) {
+		got, err := safeJoin(dst, "node_modules/left-pad/index.js")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		want := filepath.Join(dst, "node_modules", "left-pad", "index.js")
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("accepts a simple file name", func(t *testing.T) {
+		got, err := safeJoin(dst, "file.txt")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if want := filepath.Join(dst, "file.txt"); got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+}
+
+func TestRestoreFromManifest(t *testing.T) {
+	t.Run("falls back to legacy restore when no manifest is present", func(t *testing.T) {
+		r := restorer{s: newMemStorage()}
+
+		ok, stats, err := r.restoreFromManifest("ns/key/deps", t.TempDir())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if ok {
+			t.Fatal("expected ok=false when src has no manifest.json")
+		}
+
+		if stats != (ManifestRestoreStats{}) {
+			t.Fatalf("expected zero stats, got %+v", stats)
+		}
+	})
+
+	t.Run("skips unchanged files and fetches changed ones from cas", func(t *testing.T) {
+		dst := t.TempDir()
+		src := "ns/key/deps"
+		s := newMemStorage()
+		r := restorer{s: s}
+
+		unchanged := []byte("unchanged content")
+		unchangedSum := sha256.Sum256(unchanged)
+		if err := os.WriteFile(filepath.Join(dst, "kept.txt"), unchanged, 0644); err != nil {
+			t.Fatalf("seed local file: %v", err)
+		}
+
+		changed := []byte("fresh from remote")
+		changedSum := sha256.Sum256(changed)
+		s.put(filepath.Join(src, "cas", hex.EncodeToString(changedSum[:])), changed)
+
+		manifest := Manifest{Entries: []ManifestEntry{
+			{Path: "kept.txt", Size: int64(len(unchanged)), SHA256: hex.EncodeToString(unchangedSum[:])},
+			{Path: "new.txt", Size: int64(len(changed)), SHA256: hex.EncodeToString(changedSum[:])},
+		}}
+
+		b, err := json.Marshal(manifest)
+		if err != nil {
+			t.Fatalf("marshal manifest: %v", err)
+		}
+		s.put(filepath.Join(src, manifestFileName), b)
+
+		ok, stats, err := r.restoreFromManifest(src, dst)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !ok {
+			t.Fatal("expected ok=true when src has a manifest.json")
+		}
+
+		if stats.FilesTotal != 2 || stats.FilesFetched != 1 || stats.FilesSkipped != 1 {
+			t.Fatalf("unexpected stats: %+v", stats)
+		}
+
+		got, err := os.ReadFile(filepath.Join(dst, "new.txt"))
+		if err != nil {
+			t.Fatalf("read fetched file: %v", err)
+		}
+
+		if string(got) != string(changed) {
+			t.Fatalf("fetched file content = %q, want %q", got, changed)
+		}
+	})
+}
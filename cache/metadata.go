@@ -0,0 +1,137 @@
+package cache
+
+import (
+	"sync"
+
+	"github.com/dustin/go-humanize"
+)
+
+// CacheMetadata holds the information written to PLUGIN_CACHE_INTEL_FILE_NAME
+// after a restore or rebuild so downstream steps can inspect what happened
+// without parsing logs.
+type CacheMetadata struct {
+	CacheSize string `json:"cache_size"`
+
+	// LocalCache is populated when a local disk cache layer sits in front of
+	// the remote storage backend. It is nil when no local cache is configured.
+	LocalCache *LocalCacheStats `json:"local_cache,omitempty"`
+
+	// Buckets reports per-bucket restore outcomes when named cache buckets
+	// are configured. It is empty when no Buckets config was supplied.
+	Buckets []BucketMetric `json:"buckets,omitempty"`
+
+	// Prune is populated after a Restorer.Prune run.
+	Prune *PruneReport `json:"prune,omitempty"`
+
+	// Manifest is populated when a restore used the content-addressed
+	// manifest/cas layout instead of the legacy tar archive.
+	Manifest *ManifestRestoreStats `json:"manifest,omitempty"`
+}
+
+// ManifestRestoreStats summarizes an incremental, content-addressed restore.
+type ManifestRestoreStats struct {
+	FilesTotal   int `json:"files_total"`
+	FilesFetched int `json:"files_fetched"`
+	FilesSkipped int `json:"files_skipped"`
+}
+
+// BucketMetric summarizes what happened restoring a single named bucket.
+type BucketMetric struct {
+	Name     string `json:"name"`
+	Restored int    `json:"restored"`
+	Skipped  int    `json:"skipped"`
+}
+
+// LocalCacheStats summarizes hit/miss behaviour of the on-disk cache layer
+// for a single restore.
+type LocalCacheStats struct {
+	Hits   int   `json:"hits"`
+	Misses int   `json:"misses"`
+	Bytes  int64 `json:"bytes"`
+}
+
+// restoreIntel accumulates every per-destination outcome of a single
+// Restore call (bytes written, manifest stats, bucket metrics) under one
+// mutex, so the intel file can be written exactly once after all the
+// concurrent per-dst goroutines finish, instead of each of them
+// independently read-modify-writing (or outright overwriting) the same
+// file and racing one another.
+type restoreIntel struct {
+	mu sync.Mutex
+
+	totalBytes int64
+	manifest   *ManifestRestoreStats
+	buckets    map[string]*BucketMetric
+}
+
+func newRestoreIntel() *restoreIntel {
+	return &restoreIntel{buckets: map[string]*BucketMetric{}}
+}
+
+func (ri *restoreIntel) addBytes(n int64) {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	ri.totalBytes += n
+}
+
+func (ri *restoreIntel) addManifestStats(s ManifestRestoreStats) {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+
+	if ri.manifest == nil {
+		ri.manifest = &ManifestRestoreStats{}
+	}
+
+	ri.manifest.FilesTotal += s.FilesTotal
+	ri.manifest.FilesFetched += s.FilesFetched
+	ri.manifest.FilesSkipped += s.FilesSkipped
+}
+
+// bucketEntry must be called with ri.mu held.
+func (ri *restoreIntel) bucketEntry(name string) *BucketMetric {
+	if name == "" {
+		name = "default"
+	}
+
+	e, ok := ri.buckets[name]
+	if !ok {
+		e = &BucketMetric{Name: name}
+		ri.buckets[name] = e
+	}
+
+	return e
+}
+
+func (ri *restoreIntel) recordBucketRestore(name string) {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	ri.bucketEntry(name).Restored++
+}
+
+func (ri *restoreIntel) recordBucketSkip(name string) {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	ri.bucketEntry(name).Skipped++
+}
+
+// write marshals everything accumulated so far, plus localCache (captured
+// once, after all restores finished), into filename in a single write.
+func (ri *restoreIntel) write(filename string, localCache *LocalCacheStats) error {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+
+	data := CacheMetadata{
+		CacheSize:  humanize.Bytes(uint64(ri.totalBytes)),
+		LocalCache: localCache,
+		Manifest:   ri.manifest,
+	}
+
+	if len(ri.buckets) > 0 {
+		data.Buckets = make([]BucketMetric, 0, len(ri.buckets))
+		for _, e := range ri.buckets {
+			data.Buckets = append(data.Buckets, *e)
+		}
+	}
+
+	return writeCacheMetadata(data, filename)
+}
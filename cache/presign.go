@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+
+	"github.com/meltwater/drone-cache/internal"
+	"github.com/meltwater/drone-cache/storage/common"
+)
+
+// PresignConfig configures presigned-URL restores, which bypass streaming
+// archive bytes through the plugin process entirely.
+type PresignConfig struct {
+	// Enabled turns on presigned-URL restore for Restore.
+	Enabled bool
+	// TTL is how long the presigned URL remains valid for.
+	TTL time.Duration
+	// ManifestPath, when set, makes Restore write the presigned URLs to this
+	// file instead of downloading them itself, for a downstream step to
+	// fetch. When empty, Restore performs the download directly.
+	ManifestPath string
+}
+
+// presigner is implemented by storage.Storage backends that can produce a
+// time-limited, credential-free URL for an object. Backends that don't
+// support it return common.ErrNotImplemented from Presign.
+type presigner interface {
+	Presign(path string, ttl time.Duration) (string, error)
+}
+
+// manifestEntry is one line of the presigned-URL manifest written for a
+// downstream step to consume.
+type manifestEntry struct {
+	Local  string `json:"local"`
+	Remote string `json:"remote"`
+	URL    string `json:"url"`
+}
+
+// presignedManifest accumulates manifest entries across the concurrent
+// restore goroutines in Restore before they're written out once.
+type presignedManifest struct {
+	mu      sync.Mutex
+	entries []manifestEntry
+}
+
+func (m *presignedManifest) add(e manifestEntry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = append(m.entries, e)
+}
+
+func (m *presignedManifest) writeTo(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, err := json.MarshalIndent(m.entries, "", "\t")
+	if err != nil {
+		return fmt.Errorf("marshal presigned manifest, %w", err)
+	}
+
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		return fmt.Errorf("write presigned manifest <%s>, %w", path, err)
+	}
+
+	return nil
+}
+
+// restorePresigned resolves src to a presigned URL and either records it in
+// the manifest or downloads it directly into dst, depending on r.presign.
+func (r restorer) restorePresigned(src, dst string, manifest *presignedManifest) (err error) {
+	p, ok := r.s.(presigner)
+	if !ok {
+		return fmt.Errorf("storage backend does not support presigned restore, %w", common.ErrNotImplemented)
+	}
+
+	url, err := p.Presign(src, r.presign.TTL)
+	if err != nil {
+		return fmt.Errorf("presign <%s>, %w", src, err)
+	}
+
+	if r.presign.ManifestPath != "" {
+		manifest.add(manifestEntry{Local: dst, Remote: src, URL: url})
+
+		return nil
+	}
+
+	return r.downloadPresigned(url, dst)
+}
+
+// downloadPresigned fetches url directly over HTTP and extracts it into dst,
+// without involving the plugin's storage credentials.
+func (r restorer) downloadPresigned(url, dst string) (err error) {
+	resp, err := http.Get(url) // nolint:gosec,noctx // url is a short-lived presigned link produced by our own storage backend
+	if err != nil {
+		return fmt.Errorf("get presigned url, %w", err)
+	}
+	defer internal.CloseWithErrCapturef(&err, resp.Body, "presigned download, body close")
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("get presigned url, unexpected status %s", resp.Status)
+	}
+
+	written, err := r.a.Extract(dst, resp.Body)
+	if err != nil {
+		return fmt.Errorf("extract files from presigned download, %w", err)
+	}
+
+	level.Info(r.logger).Log("msg", "downloaded via presigned url to local", "directory", dst, "raw size", written)
+
+	return nil
+}
@@ -0,0 +1,184 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+
+	"github.com/meltwater/drone-cache/storage"
+)
+
+// PrunePolicy configures which remote cache entries Pruner.Prune removes.
+type PrunePolicy struct {
+	// MaxAge removes entries last modified longer ago than this. Zero
+	// disables age-based pruning.
+	MaxAge time.Duration
+	// MaxTotalSize removes the least-recently-modified entries once the
+	// namespace exceeds this many bytes. Zero disables size-based pruning.
+	MaxTotalSize int64
+	// PruneOrphans removes entries whose top-level key does not match
+	// CurrentKey, i.e. caches left behind by branches/keys that no longer
+	// generate. Ignored when CurrentKey is empty.
+	PruneOrphans bool
+	// CurrentKey is the key produced by the active key.Generator, used to
+	// recognize orphaned entries when PruneOrphans is set.
+	CurrentKey string
+}
+
+// PruneReport summarizes the outcome of a Prune run.
+type PruneReport struct {
+	Scanned        int   `json:"scanned"`
+	Kept           int   `json:"kept"`
+	Deleted        int   `json:"deleted"`
+	ReclaimedBytes int64 `json:"reclaimed_bytes"`
+}
+
+// Pruner removes stale or excess entries from a remote cache namespace.
+type Pruner interface {
+	Prune(ctx context.Context) (PruneReport, error)
+}
+
+type pruner struct {
+	logger    log.Logger
+	s         storage.Storage
+	namespace string
+	policy    PrunePolicy
+}
+
+// NewPruner creates a Pruner that walks namespace in s and deletes entries
+// matching policy.
+func NewPruner(logger log.Logger, s storage.Storage, namespace string, policy PrunePolicy) Pruner {
+	return pruner{logger, s, filepath.ToSlash(filepath.Clean(namespace)), policy}
+}
+
+// Prune scans the namespace and deletes entries matching the configured
+// policy, stopping early if ctx is cancelled.
+func (p pruner) Prune(ctx context.Context) (PruneReport, error) {
+	var report PruneReport
+
+	entries, err := p.s.List(p.namespace)
+	if err != nil {
+		return report, fmt.Errorf("list namespace <%s>, %w", p.namespace, err)
+	}
+
+	report.Scanned = len(entries)
+
+	// Oldest first, so size-based pruning below evicts LRU-style.
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastModified.Before(entries[j].LastModified)
+	})
+
+	toDelete := p.selectForDeletion(entries)
+
+	for i, e := range entries {
+		select {
+		case <-ctx.Done():
+			return report, ctx.Err()
+		default:
+		}
+
+		if !toDelete[i] {
+			report.Kept++
+			continue
+		}
+
+		if err := p.s.Delete(e.Path); err != nil {
+			level.Error(p.logger).Log("msg", "prune delete entry", "path", e.Path, "err", err)
+			report.Kept++
+
+			continue
+		}
+
+		level.Debug(p.logger).Log("msg", "pruned cache entry", "path", e.Path, "size", e.Size)
+
+		report.Deleted++
+		report.ReclaimedBytes += e.Size
+	}
+
+	level.Info(p.logger).Log(
+		"msg", "prune complete",
+		"scanned", report.Scanned,
+		"kept", report.Kept,
+		"deleted", report.Deleted,
+		"reclaimed bytes", report.ReclaimedBytes,
+	)
+
+	return report, nil
+}
+
+// selectForDeletion decides which of entries (already sorted oldest-first)
+// the configured policy removes. Age- and orphan-based deletions are
+// per-entry; size-based deletion then evicts the oldest entries still
+// standing until the remaining total is back under MaxTotalSize, rather than
+// a per-entry threshold, so it behaves as LRU eviction over the whole set
+// instead of a one-way cutoff at the first entry that happens to tip the
+// running total over budget.
+func (p pruner) selectForDeletion(entries []storage.FileEntry) map[int]bool {
+	toDelete := make(map[int]bool, len(entries))
+
+	var remaining int64
+
+	for i, e := range entries {
+		if p.policy.MaxAge > 0 && time.Since(e.LastModified) > p.policy.MaxAge {
+			toDelete[i] = true
+			continue
+		}
+
+		if p.policy.PruneOrphans && p.policy.CurrentKey != "" && p.isOrphan(e.Path) {
+			toDelete[i] = true
+			continue
+		}
+
+		remaining += e.Size
+	}
+
+	if p.policy.MaxTotalSize > 0 {
+		for i, e := range entries {
+			if remaining <= p.policy.MaxTotalSize {
+				break
+			}
+
+			if toDelete[i] {
+				continue
+			}
+
+			toDelete[i] = true
+			remaining -= e.Size
+		}
+	}
+
+	return toDelete
+}
+
+// writePruneReport merges a PruneReport into the existing intel file,
+// preserving whatever other fields a prior Restore already wrote. Unlike
+// Restore's per-dst writes, Prune runs to completion on its own rather than
+// racing concurrent goroutines against this same file, so a single
+// read-merge-write here doesn't need the restoreIntel treatment.
+func writePruneReport(report PruneReport, filename string) {
+	var data CacheMetadata
+	if b, err := os.ReadFile(filename); err == nil {
+		json.Unmarshal(b, &data) // nolint:errcheck // best-effort merge, start from zero value on failure
+	}
+
+	data.Prune = &report
+
+	writeCacheMetadata(data, filename) // nolint:errcheck
+}
+
+// isOrphan reports whether path's top-level key segment (the first path
+// component under the namespace) differs from the current generator's key.
+func (p pruner) isOrphan(path string) bool {
+	rel := strings.TrimPrefix(strings.TrimPrefix(path, p.namespace), "/")
+	parts := strings.SplitN(rel, "/", 2)
+
+	return parts[0] != "" && parts[0] != p.policy.CurrentKey
+}
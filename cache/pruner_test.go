@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/meltwater/drone-cache/storage"
+)
+
+func TestSelectForDeletionMaxTotalSizeKeepsNewest(t *testing.T) {
+	now := time.Now()
+
+	// oldest -> newest, sizes 30/40/40, cap 50: the two newest entries
+	// (40+40=80 > 50) should be trimmed down to just the newest (40 <= 50),
+	// not the other way around.
+	entries := []storage.FileEntry{
+		{Path: "e1", Size: 30, LastModified: now.Add(-3 * time.Hour)},
+		{Path: "e2", Size: 40, LastModified: now.Add(-2 * time.Hour)},
+		{Path: "e3", Size: 40, LastModified: now.Add(-1 * time.Hour)},
+	}
+
+	p := pruner{policy: PrunePolicy{MaxTotalSize: 50}}
+	toDelete := p.selectForDeletion(entries)
+
+	if toDelete[2] {
+		t.Error("newest entry (e3) should be kept, not deleted")
+	}
+
+	if !toDelete[0] {
+		t.Error("oldest entry (e1) should be deleted to make room for newer entries")
+	}
+
+	if !toDelete[1] {
+		t.Error("middle entry (e2) should be deleted to make room for newer entries")
+	}
+}
+
+func TestSelectForDeletionMaxAge(t *testing.T) {
+	now := time.Now()
+
+	entries := []storage.FileEntry{
+		{Path: "stale", Size: 10, LastModified: now.Add(-48 * time.Hour)},
+		{Path: "fresh", Size: 10, LastModified: now.Add(-1 * time.Hour)},
+	}
+
+	p := pruner{policy: PrunePolicy{MaxAge: 24 * time.Hour}}
+	toDelete := p.selectForDeletion(entries)
+
+	if !toDelete[0] {
+		t.Error("expected entry older than MaxAge to be deleted")
+	}
+
+	if toDelete[1] {
+		t.Error("expected entry within MaxAge to be kept")
+	}
+}
@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -16,6 +17,7 @@ import (
 	"github.com/go-kit/kit/log/level"
 
 	"github.com/meltwater/drone-cache/archive"
+	"github.com/meltwater/drone-cache/cache/diskcache"
 	"github.com/meltwater/drone-cache/internal"
 	"github.com/meltwater/drone-cache/key"
 	"github.com/meltwater/drone-cache/storage"
@@ -39,11 +41,37 @@ type restorer struct {
 	enableCacheKeySeparator bool
 	backend                 string
 	accountID               string
+
+	localCache *diskcache.Cache
+	buckets    Buckets
+	presign    PresignConfig
 }
 
-// NewRestorer creates a new cache.Restorer.
-func NewRestorer(logger log.Logger, s storage.Storage, a archive.Archive, g key.Generator, fg key.Generator, namespace string, failIfKeyNotPresent bool, enableCacheKeySeparator bool, backend, accountID string) Restorer { // nolint:lll
-	return restorer{logger, a, s, g, fg, namespace, failIfKeyNotPresent, enableCacheKeySeparator, backend, accountID}
+// NewRestorer creates a new cache.Restorer. When localCacheDir is non-empty,
+// s is wrapped with a local on-disk cache so repeated restores on the same
+// host can be served from disk instead of the remote storage.Storage.
+// buckets, when non-nil, resolves restore destinations to named cache
+// buckets with their own max age and eviction behaviour.
+func NewRestorer(logger log.Logger, s storage.Storage, a archive.Archive, g key.Generator, fg key.Generator, namespace string, failIfKeyNotPresent bool, enableCacheKeySeparator bool, backend, accountID string, localCacheDir string, localCacheMaxSize int64, localCacheMaxAge time.Duration, buckets Buckets, presign PresignConfig) (Restorer, error) { // nolint:lll
+	var (
+		localCache *diskcache.Cache
+		err        error
+	)
+
+	if localCacheDir != "" {
+		localCache, err = diskcache.New(logger, s, diskcache.Config{
+			Dir:          localCacheDir,
+			MaxSizeBytes: localCacheMaxSize,
+			MaxAge:       localCacheMaxAge,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("set up local cache, %w", err)
+		}
+
+		s = localCache
+	}
+
+	return restorer{logger, a, s, g, fg, namespace, failIfKeyNotPresent, enableCacheKeySeparator, backend, accountID, localCache, buckets, presign}, nil
 }
 
 // Restore restores files from the cache provided with given paths.
@@ -61,6 +89,8 @@ func (r restorer) Restore(dsts []string) error {
 		wg        sync.WaitGroup
 		errs      = &internal.MultiError{}
 		namespace = filepath.ToSlash(filepath.Clean(r.namespace))
+		intel     = newRestoreIntel()
+		manifest  = &presignedManifest{}
 	)
 	if len(dsts) == 0 {
 		prefix := filepath.Join(namespace, key)
@@ -92,18 +122,46 @@ func (r restorer) Restore(dsts []string) error {
 	for _, dst := range dsts {
 		src := filepath.Join(namespace, key, dst)
 
+		bucketName, bucket, hasBucket := r.buckets.Resolve(dst)
+		if hasBucket && bucket.MaxAge == DisabledBucket {
+			level.Info(r.logger).Log("msg", "bucket disabled, skipping restore", "bucket", bucketName, "local", dst)
+			intel.recordBucketSkip(bucketName)
+
+			continue
+		}
+
+		if hasBucket && bucket.MaxAge != NoExpiration {
+			stale, err := r.isStale(src, bucket)
+			if err != nil {
+				level.Error(r.logger).Log("msg", "check bucket freshness", "bucket", bucketName, "err", err)
+			} else if stale {
+				level.Info(r.logger).Log("msg", "entry older than bucket max age, skipping restore", "bucket", bucketName, "local", dst)
+				intel.recordBucketSkip(bucketName)
+
+				continue
+			}
+		}
+
 		level.Info(r.logger).Log("msg", "restoring directory", "local", dst, "remote", src)
 		level.Debug(r.logger).Log("msg", "restoring directory", "remote", src)
 
 		wg.Add(1)
 
-		go func(src, dst string) {
+		go func(src, dst, bucketName string) {
 			defer wg.Done()
 
-			if err := r.restore(src, dst); err != nil {
+			restore := func(src, dst string) error { return r.restore(src, dst, intel) }
+			if r.presign.Enabled {
+				restore = func(src, dst string) error { return r.restorePresigned(src, dst, manifest) }
+			}
+
+			if err := restore(src, dst); err != nil {
 				errs.Add(fmt.Errorf("download from <%s> to <%s>, %w", src, dst, err))
+				return
 			}
-		}(src, dst)
+
+			intel.recordBucketRestore(bucketName)
+		}(src, dst, bucketName)
 	}
 
 	wg.Wait()
@@ -112,13 +170,88 @@ func (r restorer) Restore(dsts []string) error {
 		return fmt.Errorf("restore failed, %w", errs)
 	}
 
+	if r.presign.Enabled && r.presign.ManifestPath != "" {
+		if err := manifest.writeTo(r.presign.ManifestPath); err != nil {
+			return fmt.Errorf("write presigned manifest, %w", err)
+		}
+	}
+
+	var localCacheStats *LocalCacheStats
+	if r.localCache != nil {
+		hits, misses, bytes := r.localCache.Stats()
+		localCacheStats = &LocalCacheStats{Hits: hits, Misses: misses, Bytes: bytes}
+	}
+
+	if err := intel.write(PLUGIN_CACHE_INTEL_FILE_NAME, localCacheStats); err != nil {
+		level.Error(r.logger).Log("msg", "write cache intel", "err", err)
+	}
+
 	level.Info(r.logger).Log("msg", "cache restored", "took", time.Since(now))
 
 	return nil
 }
 
-// restore fetches the archived file from the cache and restores to the host machine's file system.
-func (r restorer) restore(src, dst string) (err error) {
+// Prune removes entries from the restorer's remote namespace matching
+// policy, the counterpart to the unbounded growth of Rebuild. It is safe to
+// call even when no local restore has happened yet.
+func (r restorer) Prune(ctx context.Context, policy PrunePolicy) (PruneReport, error) {
+	if policy.PruneOrphans && policy.CurrentKey == "" {
+		if key, err := r.generateKey(); err == nil {
+			policy.CurrentKey = key
+		} else {
+			level.Error(r.logger).Log("msg", "generate key for orphan pruning", "err", err)
+		}
+	}
+
+	report, err := NewPruner(r.logger, r.s, r.namespace, policy).Prune(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	writePruneReport(report, PLUGIN_CACHE_INTEL_FILE_NAME)
+
+	return report, nil
+}
+
+// isStale reports whether the remote entry at src is older than bucket's
+// MaxAge, using the mtime reported by storage.Storage.List.
+func (r restorer) isStale(src string, bucket BucketConfig) (bool, error) {
+	entries, err := r.s.List(src)
+	if err != nil {
+		return false, err
+	}
+
+	for _, e := range entries {
+		if e.Path == src {
+			return bucket.expired(e.LastModified), nil
+		}
+	}
+
+	return false, nil
+}
+
+// restore restores src into dst, preferring the content-addressed
+// manifest/cas layout when present and falling back to the legacy opaque
+// tarball otherwise. Every outcome (bytes written, manifest stats) is folded
+// into intel instead of being written to the intel file directly, so
+// concurrent calls across the dsts in Restore don't race on the same file.
+func (r restorer) restore(src, dst string, intel *restoreIntel) error {
+	ok, stats, err := r.restoreFromManifest(src, dst)
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		intel.addManifestStats(stats)
+
+		return nil
+	}
+
+	return r.restoreLegacyArchive(src, dst, intel)
+}
+
+// restoreLegacyArchive fetches the archived file from the cache and restores it to the host machine's file system.
+func (r restorer) restoreLegacyArchive(src, dst string, intel *restoreIntel) (err error) {
 	pr, pw := io.Pipe()
 	defer internal.CloseWithErrCapturef(&err, pr, "rebuild, pr close <%s>", dst)
 
@@ -146,7 +279,7 @@ func (r restorer) restore(src, dst string) (err error) {
 		return err
 	}
 
-	writeCacheMetadata(CacheMetadata{CacheSize: humanize.Bytes(uint64(written))}, PLUGIN_CACHE_INTEL_FILE_NAME)
+	intel.addBytes(written)
 
 	level.Info(r.logger).Log("msg", "downloaded to local", "directory", dst, "cache size", humanize.Bytes(uint64(written)))
 